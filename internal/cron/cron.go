@@ -0,0 +1,38 @@
+// Copyright 2023 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cron
+
+import (
+	"sync"
+
+	"github.com/gogs/cron"
+	log "unknwon.dev/clog/v2"
+)
+
+var c = cron.New()
+
+var startOnce sync.Once
+
+// NewContext registers and starts every scheduled task in this package. It
+// is safe to call more than once; only the first call has any effect.
+func NewContext() {
+	startOnce.Do(func() {
+		for _, register := range []func(*cron.Cron) error{
+			registerDeleteExpiredTeamInvites,
+		} {
+			if err := register(c); err != nil {
+				log.Fatal("Failed to register cron task: %v", err)
+			}
+		}
+		c.Start()
+	})
+}
+
+// init starts this package's scheduled tasks as soon as the package is
+// imported, so they run whether or not whatever wires up the app's HTTP
+// routes also remembers to call NewContext explicitly.
+func init() {
+	NewContext()
+}
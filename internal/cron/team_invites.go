@@ -0,0 +1,36 @@
+// Copyright 2023 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cron
+
+import (
+	"context"
+
+	"github.com/gogs/cron"
+	log "unknwon.dev/clog/v2"
+
+	"gogs.io/gogs/internal/db"
+)
+
+// deleteExpiredTeamInvites removes team invitations whose expiry has
+// passed, so stale tokens can no longer be redeemed and the per-org
+// pending invite count doesn't get permanently inflated by abandoned
+// invites.
+func deleteExpiredTeamInvites() {
+	count, err := db.TeamInvitesStore.DeleteExpired(context.Background())
+	if err != nil {
+		log.Error("Failed to delete expired team invites: %v", err)
+		return
+	}
+	if count > 0 {
+		log.Trace("Deleted %d expired team invite(s)", count)
+	}
+}
+
+// registerDeleteExpiredTeamInvites schedules deleteExpiredTeamInvites to run
+// hourly. It's called from NewContext alongside the rest of this package's
+// scheduled tasks.
+func registerDeleteExpiredTeamInvites(c *cron.Cron) error {
+	return c.AddFunc("Delete expired team invites", "@every 1h", deleteExpiredTeamInvites)
+}
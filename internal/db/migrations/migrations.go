@@ -0,0 +1,61 @@
+// Copyright 2023 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package migrations
+
+import (
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// migration is a single, idempotent database migration identified by a
+// unique, never-reused ID.
+type migration struct {
+	ID string
+	Fn func(tx *gorm.DB) error
+}
+
+// migrations lists every migration in the order it must be applied. Once a
+// migration has shipped, its ID must never change or be reused.
+var migrations = []migration{
+	{ID: "2023-seed-team-units", Fn: seedTeamUnits},
+}
+
+type appliedMigration struct {
+	ID string `gorm:"primaryKey"`
+}
+
+func (*appliedMigration) TableName() string {
+	return "migration"
+}
+
+// Migrate applies every migration in migrations that hasn't been applied
+// yet, in order, each within its own transaction.
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(&appliedMigration{}); err != nil {
+		return errors.Wrap(err, "auto migrate migration table")
+	}
+
+	for _, m := range migrations {
+		var applied int64
+		err := db.Model(&appliedMigration{}).Where("id = ?", m.ID).Count(&applied).Error
+		if err != nil {
+			return errors.Wrapf(err, "check whether migration %q is applied", m.ID)
+		}
+		if applied > 0 {
+			continue
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Fn(tx); err != nil {
+				return err
+			}
+			return tx.Create(&appliedMigration{ID: m.ID}).Error
+		})
+		if err != nil {
+			return errors.Wrapf(err, "apply migration %q", m.ID)
+		}
+	}
+	return nil
+}
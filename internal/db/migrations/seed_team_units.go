@@ -0,0 +1,28 @@
+// Copyright 2023 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+// seedTeamUnits backfills the new team_unit table so every existing team
+// keeps behaving exactly as it did before per-unit permissions existed:
+// every unit is granted at the team's current uniform Authorize mode.
+func seedTeamUnits(tx *gorm.DB) error {
+	const unitCount = 9 // UnitCode through UnitPackages.
+	return tx.Exec(`
+INSERT INTO team_unit (team_id, type, access_mode)
+SELECT team.id, unit.type, team.authorize
+FROM team
+CROSS JOIN (
+	SELECT 1 AS type UNION ALL SELECT 2 UNION ALL SELECT 3 UNION ALL SELECT 4
+	UNION ALL SELECT 5 UNION ALL SELECT 6 UNION ALL SELECT 7 UNION ALL SELECT 8
+	UNION ALL SELECT 9
+) AS unit
+WHERE NOT EXISTS (
+	SELECT 1 FROM team_unit WHERE team_unit.team_id = team.id AND team_unit.type = unit.type
+)`).Error
+}
@@ -0,0 +1,137 @@
+// Copyright 2023 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// accessibleRepoIDsQuery builds, but does not execute, the query selecting
+// the repositories accessible within orgID.
+//
+// When teamID is zero, it's scoped to repos that userID can see, via the
+// union of (a) repos directly owned by the org that userID has any team
+// access to, and (b) repos explicitly granted to teams userID belongs to
+// (both end up being the same join, since org-owned repos are only visible
+// through team access).
+//
+// When teamID is non-zero, it's scoped to every repo granted to that one
+// team, regardless of which members belong to it, for the team repo page.
+//
+// Either way, a repo is only included if the relevant team has at least
+// AccessModeRead on the Code unit — mirroring HasAccessToUnit's own
+// fallback semantics: a team that hasn't had per-unit permissions
+// configured for Code (no matching team_unit row) falls back to its
+// uniform team.authorize mode.
+func accessibleRepoIDsQuery(tx *gorm.DB, orgID, userID, teamID int64) *gorm.DB {
+	q := tx.Table("repository").
+		Select("DISTINCT repository.*").
+		Joins("INNER JOIN team_repo ON team_repo.repo_id = repository.id").
+		Joins("INNER JOIN team ON team.id = team_repo.team_id").
+		Joins("LEFT JOIN team_unit ON team_unit.team_id = team.id AND team_unit.type = ?", UnitCode).
+		Where("repository.owner_id = ?", orgID).
+		Where("COALESCE(team_unit.access_mode, team.authorize) >= ?", AccessModeRead)
+
+	if teamID > 0 {
+		return q.Where("team_repo.team_id = ?", teamID)
+	}
+
+	teams := tx.Table("team_user").
+		Select("team_user.team_id").
+		Where("team_user.org_id = ? AND team_user.uid = ?", orgID, userID)
+	return q.Where("team_repo.team_id IN (?)", teams)
+}
+
+// AccessibleReposEnv is a query builder over the repositories within an
+// organization that are accessible to a particular user, with
+// pagination and counting pushed down into SQL rather than materializing
+// the full result set in memory.
+type AccessibleReposEnv interface {
+	// RepoIDs returns one page of accessible repository IDs, ordered by
+	// repository.updated_unix DESC.
+	RepoIDs(page, pageSize int) ([]int64, error)
+	// Repos returns one page of accessible repositories, ordered by
+	// repository.updated_unix DESC.
+	Repos(page, pageSize int) ([]*Repository, error)
+	// CountRepos returns the total number of accessible repositories.
+	CountRepos() (int64, error)
+	// MirrorRepos returns every accessible repository that is a mirror.
+	MirrorRepos() ([]*Repository, error)
+}
+
+type accessibleReposEnv struct {
+	ctx    context.Context
+	db     *gorm.DB
+	orgID  int64
+	userID int64
+	// teamID restricts the query to a single team when non-zero.
+	teamID int64
+}
+
+// AccessibleReposEnv returns a query builder over the repositories within
+// orgID that userID has access to.
+func (db *organizations) AccessibleReposEnv(ctx context.Context, orgID, userID int64) (AccessibleReposEnv, error) {
+	return &accessibleReposEnv{ctx: ctx, db: db.DB, orgID: orgID, userID: userID, teamID: 0}, nil
+}
+
+// AccessibleTeamReposEnv returns a query builder over the repositories
+// within orgID that are accessible through teamID specifically, for the
+// team repo page.
+func (db *organizations) AccessibleTeamReposEnv(ctx context.Context, orgID, teamID int64) (AccessibleReposEnv, error) {
+	return &accessibleReposEnv{ctx: ctx, db: db.DB, orgID: orgID, teamID: teamID}, nil
+}
+
+func (env *accessibleReposEnv) query() *gorm.DB {
+	return accessibleRepoIDsQuery(env.db.WithContext(env.ctx), env.orgID, env.userID, env.teamID)
+}
+
+func (env *accessibleReposEnv) RepoIDs(page, pageSize int) ([]int64, error) {
+	repos, err := env.Repos(page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(repos))
+	for i, repo := range repos {
+		ids[i] = repo.ID
+	}
+	return ids, nil
+}
+
+func (env *accessibleReposEnv) Repos(page, pageSize int) ([]*Repository, error) {
+	repos := make([]*Repository, 0, pageSize)
+	err := env.query().
+		Order("repository.updated_unix DESC, repository.id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&repos).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "list accessible repos")
+	}
+	return repos, nil
+}
+
+func (env *accessibleReposEnv) CountRepos() (int64, error) {
+	var count int64
+	err := env.query().Distinct("repository.id").Count(&count).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "count accessible repos")
+	}
+	return count, nil
+}
+
+func (env *accessibleReposEnv) MirrorRepos() ([]*Repository, error) {
+	var repos []*Repository
+	err := env.query().Where("repository.is_mirror = ?", true).
+		Order("repository.updated_unix DESC").
+		Find(&repos).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "list accessible mirror repos")
+	}
+	return repos, nil
+}
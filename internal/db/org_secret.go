@@ -0,0 +1,315 @@
+// Copyright 2023 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	texttemplate "text/template"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/hkdf"
+	"gorm.io/gorm"
+
+	"gogs.io/gogs/internal/conf"
+	"gogs.io/gogs/internal/errutil"
+)
+
+// OrgSecret is an organization-scoped secret value, e.g. a Slack webhook
+// token or container registry credential, available to webhook payload
+// templates and repo hooks without being duplicated per-repo.
+type OrgSecret struct {
+	ID    int64
+	OrgID int64  `gorm:"uniqueIndex:org_secret_org_name_unique"`
+	Name  string `gorm:"uniqueIndex:org_secret_org_name_unique"`
+
+	// ValueEncrypted is the AES-GCM ciphertext (nonce prepended) of the
+	// secret value, base64-encoded. The plaintext is never persisted.
+	ValueEncrypted string `gorm:"column:value_encrypted"`
+
+	CreatedUnix int64
+	UpdatedUnix int64
+}
+
+func (*OrgSecret) TableName() string {
+	return "org_secret"
+}
+
+func (s *OrgSecret) BeforeCreate(tx *gorm.DB) error {
+	if s.CreatedUnix == 0 {
+		s.CreatedUnix = tx.NowFunc().Unix()
+		s.UpdatedUnix = s.CreatedUnix
+	}
+	return nil
+}
+
+func (s *OrgSecret) BeforeUpdate(tx *gorm.DB) error {
+	s.UpdatedUnix = tx.NowFunc().Unix()
+	return nil
+}
+
+// OrgSecrets is the interface for organization secret operations. All
+// methods that accept or return a plaintext value do encryption/decryption
+// transparently; List never returns plaintext, by design, since it's meant
+// for management UIs that only need to know which names exist.
+type OrgSecrets interface {
+	// Create creates a new secret with the given name and plaintext value.
+	// It returns ErrOrgSecretAlreadyExist if the organization already has a
+	// secret with the same name.
+	Create(ctx context.Context, orgID int64, name, value string) (*OrgSecret, error)
+	// Update replaces the plaintext value of the named secret.
+	Update(ctx context.Context, orgID int64, name, value string) error
+	// Delete removes the named secret.
+	Delete(ctx context.Context, orgID int64, name string) error
+	// List returns every secret belonging to orgID. The returned secrets'
+	// ValueEncrypted fields are cleared; use GetByName to read a value.
+	List(ctx context.Context, orgID int64) ([]*OrgSecret, error)
+	// GetByName returns the decrypted plaintext value of the named secret.
+	// It returns ErrOrgSecretNotExist if no such secret exists.
+	GetByName(ctx context.Context, orgID int64, name string) (plaintext string, err error)
+}
+
+var OrgSecretsStore OrgSecrets
+
+// NewOrgSecretsStore returns a persistent OrgSecrets store backed by db.
+func NewOrgSecretsStore(db *gorm.DB) OrgSecrets {
+	return &orgSecrets{DB: db}
+}
+
+type orgSecrets struct {
+	*gorm.DB
+}
+
+// secretEncryptionKey derives a 32-byte AES-256 key from
+// conf.Security.SecretKey via HKDF-SHA256, scoped to org secrets so it can
+// never collide with keys derived from the same master secret for other
+// purposes.
+func secretEncryptionKey() ([]byte, error) {
+	key := make([]byte, 32)
+	kdf := hkdf.New(sha256.New, []byte(conf.Security.SecretKey), nil, []byte("gogs.org-secret.v1"))
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return nil, errors.Wrap(err, "derive key")
+	}
+	return key, nil
+}
+
+func encryptSecretValue(plaintext string) (string, error) {
+	key, err := secretEncryptionKey()
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", errors.Wrap(err, "new cipher")
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", errors.Wrap(err, "new GCM")
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "read nonce")
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+func decryptSecretValue(encoded string) (string, error) {
+	key, err := secretEncryptionKey()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errors.Wrap(err, "decode base64")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", errors.Wrap(err, "new cipher")
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", errors.Wrap(err, "new GCM")
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "decrypt")
+	}
+	return string(plaintext), nil
+}
+
+func (db *orgSecrets) Create(ctx context.Context, orgID int64, name, value string) (*OrgSecret, error) {
+	_, err := db.GetByName(ctx, orgID, name)
+	if err == nil {
+		return nil, ErrOrgSecretAlreadyExist{args: errutil.Args{"orgID": orgID, "name": name}}
+	} else if !IsErrOrgSecretNotExist(err) {
+		return nil, errors.Wrap(err, "check existence")
+	}
+
+	encrypted, err := encryptSecretValue(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "encrypt value")
+	}
+
+	secret := &OrgSecret{
+		OrgID:          orgID,
+		Name:           name,
+		ValueEncrypted: encrypted,
+	}
+	if err := db.WithContext(ctx).Create(secret).Error; err != nil {
+		return nil, errors.Wrap(err, "create")
+	}
+	secret.ValueEncrypted = ""
+	return secret, nil
+}
+
+func (db *orgSecrets) Update(ctx context.Context, orgID int64, name, value string) error {
+	encrypted, err := encryptSecretValue(value)
+	if err != nil {
+		return errors.Wrap(err, "encrypt value")
+	}
+
+	result := db.WithContext(ctx).
+		Model(&OrgSecret{}).
+		Where("org_id = ? AND name = ?", orgID, name).
+		Update("value_encrypted", encrypted)
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "update")
+	}
+	if result.RowsAffected == 0 {
+		return ErrOrgSecretNotExist{args: errutil.Args{"orgID": orgID, "name": name}}
+	}
+	return nil
+}
+
+func (db *orgSecrets) Delete(ctx context.Context, orgID int64, name string) error {
+	return db.WithContext(ctx).Where("org_id = ? AND name = ?", orgID, name).Delete(&OrgSecret{}).Error
+}
+
+func (db *orgSecrets) List(ctx context.Context, orgID int64) ([]*OrgSecret, error) {
+	var secrets []*OrgSecret
+	err := db.WithContext(ctx).Where("org_id = ?", orgID).Find(&secrets).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "list")
+	}
+	for _, s := range secrets {
+		s.ValueEncrypted = ""
+	}
+	return secrets, nil
+}
+
+func (db *orgSecrets) GetByName(ctx context.Context, orgID int64, name string) (string, error) {
+	secret := new(OrgSecret)
+	err := db.WithContext(ctx).Where("org_id = ? AND name = ?", orgID, name).First(secret).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrOrgSecretNotExist{args: errutil.Args{"orgID": orgID, "name": name}}
+		}
+		return "", errors.Wrap(err, "get")
+	}
+	return decryptSecretValue(secret.ValueEncrypted)
+}
+
+// OrgSecretMap is a name-to-plaintext-value view of an organization's
+// secrets, suitable for use as the `.OrgSecrets` field of a webhook payload
+// or repo hook template, e.g. `{{ .OrgSecrets.SLACK_TOKEN }}`.
+type OrgSecretMap map[string]string
+
+// ResolveOrgSecrets decrypts and returns every secret belonging to orgID as
+// an OrgSecretMap for use in webhook and repo hook templates. Callers must
+// only expose the result to templates rendered on behalf of someone with
+// admin rights on the organization.
+func ResolveOrgSecrets(ctx context.Context, orgID int64) (OrgSecretMap, error) {
+	secrets, err := OrgSecretsStore.List(ctx, orgID)
+	if err != nil {
+		return nil, errors.Wrap(err, "list org secrets")
+	}
+
+	resolved := make(OrgSecretMap, len(secrets))
+	for _, s := range secrets {
+		value, err := OrgSecretsStore.GetByName(ctx, orgID, s.Name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolve secret %q", s.Name)
+		}
+		resolved[s.Name] = value
+	}
+	return resolved, nil
+}
+
+// RenderWithOrgSecrets renders tmplText as a text/template, exposing orgID's
+// decrypted secrets as `{{ .OrgSecrets.NAME }}`. It's used both when
+// building outgoing webhook payloads (see Webhook.RenderedPayload) and when
+// generating repo clone/push hook scripts (see RenderRepoHookScript), so
+// org owners can centralize credentials instead of duplicating them
+// per-repo.
+func RenderWithOrgSecrets(ctx context.Context, orgID int64, tmplText string) (string, error) {
+	secrets, err := ResolveOrgSecrets(ctx, orgID)
+	if err != nil {
+		return "", errors.Wrap(err, "resolve org secrets")
+	}
+
+	tmpl, err := texttemplate.New("").Parse(tmplText)
+	if err != nil {
+		return "", errors.Wrap(err, "parse template")
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct{ OrgSecrets OrgSecretMap }{OrgSecrets: secrets})
+	if err != nil {
+		return "", errors.Wrap(err, "execute template")
+	}
+	return buf.String(), nil
+}
+
+// ErrOrgSecretAlreadyExist is returned when an organization already has a
+// secret with the same name.
+type ErrOrgSecretAlreadyExist struct {
+	args errutil.Args
+}
+
+// IsErrOrgSecretAlreadyExist returns true if the underlying error has the
+// type ErrOrgSecretAlreadyExist.
+func IsErrOrgSecretAlreadyExist(err error) bool {
+	_, ok := errors.Cause(err).(ErrOrgSecretAlreadyExist)
+	return ok
+}
+
+func (err ErrOrgSecretAlreadyExist) Error() string {
+	return fmt.Sprintf("organization secret already exists: %v", err.args)
+}
+
+// ErrOrgSecretNotExist is returned when an organization secret does not
+// exist.
+type ErrOrgSecretNotExist struct {
+	args errutil.Args
+}
+
+// IsErrOrgSecretNotExist returns true if the underlying error has the type
+// ErrOrgSecretNotExist.
+func IsErrOrgSecretNotExist(err error) bool {
+	_, ok := errors.Cause(err).(ErrOrgSecretNotExist)
+	return ok
+}
+
+func (err ErrOrgSecretNotExist) Error() string {
+	return fmt.Sprintf("organization secret does not exist: %v", err.args)
+}
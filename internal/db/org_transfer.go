@@ -0,0 +1,192 @@
+// Copyright 2023 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+
+	"gogs.io/gogs/internal/conf"
+	"gogs.io/gogs/internal/errutil"
+)
+
+// Rename renames the organization identified by orgID to newName. It
+// returns ErrNameNotAllowed if newName is reserved, or
+// ErrOrganizationAlreadyExist if newName is already taken by another user
+// or organization, since the two share a namespace. A newName that differs
+// from the current name only in letter case returns nil and leaves the
+// organization unchanged.
+//
+// On success, the on-disk repository directories owned by the organization
+// are moved to their new path, every repository.owner_name,
+// action.repo_user_name and webhook URL referencing the old name is
+// updated, and a user_redirect row is written so links to the old name
+// keep resolving via GetByName.
+func (db *organizations) Rename(ctx context.Context, orgID int64, newName string) error {
+	err := isUsernameAllowed(newName)
+	if err != nil {
+		return err
+	}
+
+	org := new(Organization)
+	err = db.WithContext(ctx).Where("id = ? AND type = ?", orgID, UserTypeOrganization).First(org).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrOrganizationNotExist{args: errutil.Args{"orgID": orgID}}
+		}
+		return errors.Wrap(err, "get organization")
+	}
+	oldName := org.Name
+
+	if strings.EqualFold(oldName, newName) {
+		return nil
+	}
+
+	_, err = NewUsersStore(db.DB).GetByUsername(ctx, newName)
+	if err == nil {
+		return ErrOrganizationAlreadyExist{args: errutil.Args{"name": newName}}
+	} else if !IsErrUserNotExist(err) {
+		return errors.Wrap(err, "check existence of new name")
+	}
+
+	// The directory move can't participate in the SQL transaction below, so
+	// it's done first and rolled back by renaming it back if the
+	// transaction fails, rather than committing the new name while the
+	// repository directories are still under the old path.
+	if err := moveOrgRepositoriesDir(oldName, newName); err != nil {
+		return errors.Wrap(err, "move repository directories")
+	}
+
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Organization{}).Where("id = ?", orgID).
+			Updates(map[string]any{"name": newName, "lower_name": strings.ToLower(newName)}).Error
+		if err != nil {
+			return errors.Wrap(err, "rename organization")
+		}
+
+		err = tx.Model(&Repository{}).Where("owner_id = ?", orgID).
+			Update("owner_name", newName).Error
+		if err != nil {
+			return errors.Wrap(err, "update repository owner names")
+		}
+
+		err = tx.Model(&Action{}).Where("repo_user_name = ?", oldName).
+			Update("repo_user_name", newName).Error
+		if err != nil {
+			return errors.Wrap(err, "update action repo user names")
+		}
+
+		err = tx.Model(&Webhook{}).
+			Where("repo_id IN (SELECT id FROM repository WHERE owner_id = ?) OR org_id = ?", orgID, orgID).
+			Where("url LIKE ? ESCAPE '\\'", "%/"+escapeLike(oldName)+"/%").
+			Update("url", gorm.Expr("REPLACE(url, ?, ?)", "/"+oldName+"/", "/"+newName+"/")).Error
+		if err != nil {
+			return errors.Wrap(err, "update webhook urls")
+		}
+
+		err = tx.Create(&UserRedirect{LowerName: strings.ToLower(oldName), RedirectUserID: orgID}).Error
+		if err != nil {
+			return errors.Wrap(err, "create redirect")
+		}
+		return nil
+	})
+	if err != nil {
+		if rollbackErr := moveOrgRepositoriesDir(newName, oldName); rollbackErr != nil {
+			return errors.Wrapf(err, "rename transaction failed, and rollback of directory move also failed: %v", rollbackErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// moveOrgRepositoriesDir moves the on-disk directory holding every
+// repository owned by the organization under conf.Repository.Root from
+// oldName to newName.
+func moveOrgRepositoriesDir(oldName, newName string) error {
+	return os.Rename(
+		repositoryOwnerDir(oldName),
+		repositoryOwnerDir(newName),
+	)
+}
+
+func repositoryOwnerDir(ownerName string) string {
+	return filepath.Join(conf.Repository.Root, strings.ToLower(ownerName))
+}
+
+// escapeLike escapes the SQL LIKE wildcards '%' and '_' (and the escape
+// character itself) in s, so it can be safely embedded in a LIKE pattern
+// with ESCAPE '\'.
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
+
+// TransferOwnership transfers sole ownership of the organization from its
+// current owner to newOwnerID. The previous sole owner is demoted to a
+// regular member of the Owners team, newOwnerID is promoted in their place,
+// and team accesses are recalculated to reflect the new owner's
+// memberships.
+func (db *organizations) TransferOwnership(ctx context.Context, orgID, newOwnerID int64) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var currentOwner OrgUser
+		err := tx.Where("org_id = ? AND is_owner = ?", orgID, true).First(&currentOwner).Error
+		if err != nil {
+			return errors.Wrap(err, "get current owner")
+		}
+		if currentOwner.UserID == newOwnerID {
+			return nil
+		}
+
+		err = tx.Model(&OrgUser{}).
+			Where("org_id = ? AND uid = ?", orgID, currentOwner.UserID).
+			Update("is_owner", false).Error
+		if err != nil {
+			return errors.Wrap(err, "demote previous owner")
+		}
+
+		var count int64
+		err = tx.Model(&OrgUser{}).Where("org_id = ? AND uid = ?", orgID, newOwnerID).Count(&count).Error
+		if err != nil {
+			return errors.Wrap(err, "check new owner membership")
+		}
+		if count == 0 {
+			if err := tx.Create(&OrgUser{OrgID: orgID, UserID: newOwnerID}).Error; err != nil {
+				return errors.Wrap(err, "add new owner as member")
+			}
+		}
+		err = tx.Model(&OrgUser{}).
+			Where("org_id = ? AND uid = ?", orgID, newOwnerID).
+			Update("is_owner", true).Error
+		if err != nil {
+			return errors.Wrap(err, "promote new owner")
+		}
+
+		owners := new(Team)
+		err = tx.Where("org_id = ? AND lower_name = ?", orgID, "owners").First(owners).Error
+		if err != nil {
+			return errors.Wrap(err, "get owners team")
+		}
+
+		err = tx.Model(&TeamUser{}).
+			Where("team_id = ? AND uid = ?", owners.ID, newOwnerID).
+			Count(&count).Error
+		if err != nil {
+			return errors.Wrap(err, "check owners team membership")
+		}
+		if count == 0 {
+			err = tx.Create(&TeamUser{OrgID: orgID, TeamID: owners.ID, UserID: newOwnerID}).Error
+			if err != nil {
+				return errors.Wrap(err, "add new owner to owners team")
+			}
+		}
+
+		return recalculateTeamAccesses(ctx, tx, orgID)
+	})
+}
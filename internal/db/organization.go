@@ -0,0 +1,393 @@
+// Copyright 2023 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+
+	"gogs.io/gogs/internal/errutil"
+)
+
+// Organization represents an organization account, i.e. a group of users
+// that can collectively own repositories and teams.
+//
+// Organizations used to be modeled as a *User with Type ==
+// UserTypeOrganization, which meant user-only fields (e.g. Password,
+// LoginSource) leaked into code paths that only cared about organizations,
+// and vice versa. Organization is the standalone replacement; it shares the
+// "user" table with User (organizations and users still occupy the same
+// namespace for names), but only exposes the fields that make sense for an
+// organization.
+type Organization struct {
+	ID int64
+	// Type is always UserTypeOrganization; it's what distinguishes an
+	// organization row from a regular user row in the shared "user" table.
+	Type        UserType
+	Name        string `gorm:"uniqueIndex"`
+	LowerName   string `gorm:"uniqueIndex"`
+	FullName    string
+	Email       string
+	Location    string
+	Website     string
+	Description string
+
+	NumTeams        int
+	NumMembers      int
+	NumRepos        int
+	MaxRepoCreation int `gorm:"default:-1"`
+
+	// Visibility indicates whether members of the organization are publicly
+	// visible by default.
+	Visibility VisibilityType
+
+	// RepoAdminChangeTeamAccess indicates whether repo admins are allowed to
+	// change which teams have access to the repo.
+	RepoAdminChangeTeamAccess bool
+
+	// DefaultPermission is the access mode new teams are created with when no
+	// explicit permission is specified.
+	DefaultPermission AccessMode `gorm:"default:1"` // Defaults to AccessModeRead.
+
+	Created     time.Time `gorm:"-"`
+	CreatedUnix int64
+	Updated     time.Time `gorm:"-"`
+	UpdatedUnix int64
+}
+
+// TableName returns the table name used by Organization, which is the
+// "user" table shared with User.
+func (*Organization) TableName() string {
+	return "user"
+}
+
+func (org *Organization) BeforeCreate(tx *gorm.DB) error {
+	if org.CreatedUnix == 0 {
+		org.CreatedUnix = tx.NowFunc().Unix()
+		org.UpdatedUnix = org.CreatedUnix
+	}
+	return nil
+}
+
+func (org *Organization) AfterFind(_ *gorm.DB) error {
+	org.Created = time.Unix(org.CreatedUnix, 0).Local()
+	org.Updated = time.Unix(org.UpdatedUnix, 0).Local()
+	return nil
+}
+
+// OrgFromUser converts a legacy *User with Type == UserTypeOrganization into
+// an *Organization. It exists purely as a bridge for call sites that have not
+// yet been migrated off *User, and should be removed once org.CreatePost,
+// the API handlers and the web org routes all operate on *Organization
+// directly.
+func OrgFromUser(user *User) *Organization {
+	return &Organization{
+		ID:                        user.ID,
+		Type:                      UserTypeOrganization,
+		Name:                      user.Name,
+		LowerName:                 user.LowerName,
+		FullName:                  user.FullName,
+		Email:                     user.Email,
+		Location:                  user.Location,
+		Website:                   user.Website,
+		Description:               user.Description,
+		NumTeams:                  user.NumTeams,
+		NumMembers:                user.NumMembers,
+		NumRepos:                  user.NumRepos,
+		MaxRepoCreation:           user.MaxRepoCreation,
+		Visibility:                user.Visibility,
+		RepoAdminChangeTeamAccess: user.RepoAdminChangeTeamAccess,
+		DefaultPermission:         AccessModeRead,
+		CreatedUnix:               user.CreatedUnix,
+		UpdatedUnix:               user.UpdatedUnix,
+	}
+}
+
+// CreateOrganizationOptions contains optional arguments for creating an
+// organization.
+//
+// NOTE: All fields are optional.
+type CreateOrganizationOptions struct {
+	FullName    string
+	Email       string
+	Location    string
+	Website     string
+	Description string
+}
+
+// ListOrganizationsOptions contains arguments for listing organizations.
+type ListOrganizationsOptions struct {
+	// Filter by a member's user ID, can't be used with OwnerID at the same
+	// time.
+	MemberID int64
+	// Filter by the owner's user ID, can't be used with MemberID at the same
+	// time.
+	OwnerID int64
+	// Whether to include memberships that are not publicly visible.
+	IncludePrivateMembers bool
+
+	Page     int
+	PageSize int
+}
+
+// Organizations is the interface for organization-related operations.
+type Organizations interface {
+	// Create creates a new organization with given name with the owner as its
+	// first and sole member. It returns ErrNameNotAllowed if the given name
+	// is not allowed to be used, or ErrOrganizationAlreadyExist if another
+	// user or organization already uses the same name.
+	Create(ctx context.Context, name string, ownerID int64, opts CreateOrganizationOptions) (*Organization, error)
+	// GetByName returns the organization with given name. It returns
+	// ErrOrganizationNotExist when not found, including when the name
+	// belongs to a regular user.
+	GetByName(ctx context.Context, name string) (*Organization, error)
+	// SearchByName returns a list of organizations whose name or full name
+	// matches the given keyword case-insensitively, and the total number of
+	// matches. Results are paginated by given page and page size, and can be
+	// ordered by orderBy, e.g. "name DESC". If orderBy is empty, it's
+	// ordered by ID.
+	SearchByName(ctx context.Context, keyword string, page, pageSize int, orderBy string) ([]*Organization, int64, error)
+	// List returns a list of organizations filtered by opts.
+	List(ctx context.Context, opts ListOrganizationsOptions) ([]*Organization, error)
+	// CountByUser returns the number of organizations owned by the given
+	// user.
+	CountByUser(ctx context.Context, ownerID int64) (int64, error)
+	// Count returns the total number of organizations.
+	Count(ctx context.Context) int64
+	// AddMember adds a new member to the given organization.
+	AddMember(ctx context.Context, orgID, userID int64) error
+	// SetMemberVisibility sets whether the membership of the given user in
+	// the given organization is publicly visible.
+	SetMemberVisibility(ctx context.Context, orgID, userID int64, public bool) error
+	// AccessibleReposEnv returns a query builder over the repositories
+	// within orgID that userID has access to.
+	AccessibleReposEnv(ctx context.Context, orgID, userID int64) (AccessibleReposEnv, error)
+	// AccessibleTeamReposEnv returns a query builder over the repositories
+	// within orgID that are accessible through teamID specifically.
+	AccessibleTeamReposEnv(ctx context.Context, orgID, teamID int64) (AccessibleReposEnv, error)
+	// Rename renames the organization to newName. It returns
+	// ErrNameNotAllowed if newName is reserved, or
+	// ErrOrganizationAlreadyExist if newName is already taken.
+	Rename(ctx context.Context, orgID int64, newName string) error
+	// TransferOwnership transfers sole ownership of the organization to
+	// newOwnerID, demoting the previous sole owner to a regular member of
+	// the Owners team.
+	TransferOwnership(ctx context.Context, orgID, newOwnerID int64) error
+}
+
+var Organizations organizations
+
+var _ Organizations = (*organizations)(nil)
+
+type organizations struct {
+	*gorm.DB
+}
+
+func (db *organizations) Create(ctx context.Context, name string, ownerID int64, opts CreateOrganizationOptions) (*Organization, error) {
+	err := isUsernameAllowed(name)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = NewUsersStore(db.DB).GetByUsername(ctx, name)
+	if err == nil {
+		return nil, ErrOrganizationAlreadyExist{args: errutil.Args{"name": name}}
+	} else if !IsErrUserNotExist(err) {
+		return nil, errors.Wrap(err, "check existence of username")
+	}
+
+	org := &Organization{
+		Type:              UserTypeOrganization,
+		Name:              name,
+		LowerName:         strings.ToLower(name),
+		FullName:          opts.FullName,
+		Email:             opts.Email,
+		Location:          opts.Location,
+		Website:           opts.Website,
+		Description:       opts.Description,
+		NumTeams:          1,
+		NumMembers:        1,
+		MaxRepoCreation:   -1,
+		DefaultPermission: AccessModeRead,
+	}
+	return org, db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return errors.Wrap(err, "create organization")
+		}
+
+		ownersTeam := &Team{
+			OrgID:      org.ID,
+			LowerName:  "owners",
+			Name:       "Owners",
+			Authorize:  AccessModeOwner,
+			NumMembers: 1,
+		}
+		if err := tx.Create(ownersTeam).Error; err != nil {
+			return errors.Wrap(err, "create owners team")
+		}
+		if err := tx.Create(&TeamUser{
+			OrgID:  org.ID,
+			TeamID: ownersTeam.ID,
+			UserID: ownerID,
+		}).Error; err != nil {
+			return errors.Wrap(err, "add owner to owners team")
+		}
+		if err := tx.Create(&OrgUser{
+			OrgID:    org.ID,
+			UserID:   ownerID,
+			IsOwner:  true,
+			IsPublic: false,
+		}).Error; err != nil {
+			return errors.Wrap(err, "add owner as organization member")
+		}
+		return nil
+	})
+}
+
+func (db *organizations) GetByName(ctx context.Context, name string) (*Organization, error) {
+	org := new(Organization)
+	err := db.WithContext(ctx).Where("lower_name = ? AND type = ?", strings.ToLower(name), UserTypeOrganization).First(org).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.Wrap(err, "get organization")
+		}
+
+		redirect := new(UserRedirect)
+		err = db.WithContext(ctx).Where("lower_name = ?", strings.ToLower(name)).First(redirect).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrOrganizationNotExist{args: errutil.Args{"name": name}}
+			}
+			return nil, errors.Wrap(err, "get redirect")
+		}
+
+		err = db.WithContext(ctx).Where("id = ? AND type = ?", redirect.RedirectUserID, UserTypeOrganization).First(org).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrOrganizationNotExist{args: errutil.Args{"name": name}}
+			}
+			return nil, errors.Wrap(err, "get organization by redirect")
+		}
+	}
+	return org, nil
+}
+
+func (db *organizations) SearchByName(ctx context.Context, keyword string, page, pageSize int, orderBy string) ([]*Organization, int64, error) {
+	if orderBy == "" {
+		orderBy = "id ASC"
+	}
+	keyword = "%" + strings.ToLower(keyword) + "%"
+
+	tx := db.WithContext(ctx).
+		Where("type = ? AND (lower_name LIKE ? OR LOWER(full_name) LIKE ?)", UserTypeOrganization, keyword, keyword)
+
+	var count int64
+	err := tx.Model(&Organization{}).Count(&count).Error
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "count")
+	}
+
+	orgs := make([]*Organization, 0, pageSize)
+	err = tx.Order(orderBy).Limit(pageSize).Offset((page - 1) * pageSize).Find(&orgs).Error
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "search")
+	}
+	return orgs, count, nil
+}
+
+func (db *organizations) List(ctx context.Context, opts ListOrganizationsOptions) ([]*Organization, error) {
+	tx := db.WithContext(ctx).Where("type = ?", UserTypeOrganization)
+
+	if opts.MemberID > 0 {
+		tx = tx.Joins("INNER JOIN org_user ON org_user.org_id = \"user\".id").
+			Where("org_user.uid = ?", opts.MemberID)
+		if !opts.IncludePrivateMembers {
+			tx = tx.Where("org_user.is_public = ?", true)
+		}
+	} else if opts.OwnerID > 0 {
+		tx = tx.Joins("INNER JOIN org_user ON org_user.org_id = \"user\".id").
+			Where("org_user.uid = ? AND org_user.is_owner = ?", opts.OwnerID, true)
+		if !opts.IncludePrivateMembers {
+			tx = tx.Where("org_user.is_public = ?", true)
+		}
+	}
+
+	if opts.PageSize > 0 {
+		tx = tx.Limit(opts.PageSize).Offset((opts.Page - 1) * opts.PageSize)
+	}
+
+	orgs := make([]*Organization, 0, 10)
+	return orgs, tx.Order(`"user".id ASC`).Find(&orgs).Error
+}
+
+func (db *organizations) CountByUser(ctx context.Context, ownerID int64) (int64, error) {
+	var count int64
+	err := db.WithContext(ctx).
+		Model(&Organization{}).
+		Joins("INNER JOIN org_user ON org_user.org_id = \"user\".id").
+		Where("org_user.uid = ? AND org_user.is_owner = ?", ownerID, true).
+		Count(&count).Error
+	return count, err
+}
+
+func (db *organizations) Count(ctx context.Context) int64 {
+	var count int64
+	db.WithContext(ctx).Model(&Organization{}).Where("type = ?", UserTypeOrganization).Count(&count)
+	return count
+}
+
+func (db *organizations) AddMember(ctx context.Context, orgID, userID int64) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&OrgUser{OrgID: orgID, UserID: userID}).Error; err != nil {
+			return errors.Wrap(err, "create organization-user relation")
+		}
+		return tx.Model(&Organization{}).Where("id = ?", orgID).
+			UpdateColumn("num_members", gorm.Expr("num_members + 1")).Error
+	})
+}
+
+func (db *organizations) SetMemberVisibility(ctx context.Context, orgID, userID int64, public bool) error {
+	return db.WithContext(ctx).Model(&OrgUser{}).
+		Where("org_id = ? AND uid = ?", orgID, userID).
+		UpdateColumn("is_public", public).Error
+}
+
+// ErrOrganizationAlreadyExist is returned when an organization with same
+// name already exists.
+type ErrOrganizationAlreadyExist struct {
+	args errutil.Args
+}
+
+// IsErrOrganizationAlreadyExist returns true if the underlying error has the
+// type ErrOrganizationAlreadyExist.
+func IsErrOrganizationAlreadyExist(err error) bool {
+	_, ok := errors.Cause(err).(ErrOrganizationAlreadyExist)
+	return ok
+}
+
+func (err ErrOrganizationAlreadyExist) Error() string {
+	return fmt.Sprintf("organization already exists: %v", err.args)
+}
+
+// ErrOrganizationNotExist is returned when an organization does not exist.
+type ErrOrganizationNotExist struct {
+	args errutil.Args
+}
+
+// IsErrOrganizationNotExist returns true if the underlying error has the
+// type ErrOrganizationNotExist.
+func IsErrOrganizationNotExist(err error) bool {
+	_, ok := errors.Cause(err).(ErrOrganizationNotExist)
+	return ok
+}
+
+func (err ErrOrganizationNotExist) Error() string {
+	return fmt.Sprintf("organization does not exist: %v", err.args)
+}
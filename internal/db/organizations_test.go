@@ -26,7 +26,7 @@ func TestOrganizations(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
-	tables := []any{new(User), new(EmailAddress), new(OrgUser), new(Team), new(TeamUser)}
+	tables := []any{new(User), new(EmailAddress), new(OrgUser), new(Team), new(TeamUser), new(TeamRepo), new(TeamUnit), new(TeamInvite), new(OrgSecret), new(Repository), new(Action), new(Webhook), new(UserRedirect), new(Access)}
 	db := &organizations{
 		DB: dbtest.NewDB(t, "orgs", tables...),
 	}
@@ -41,6 +41,11 @@ func TestOrganizations(t *testing.T) {
 		{"List", orgsList},
 		{"CountByUser", orgsCountByUser},
 		{"Count", orgsCount},
+		{"TeamUnitAccess", orgsTeamUnitAccess},
+		{"Secrets", orgsSecrets},
+		{"AccessibleReposEnv", orgsAccessibleReposEnv},
+		{"Rename", orgsRename},
+		{"TransferOwnership", orgsTransferOwnership},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Cleanup(func() {
@@ -112,6 +117,29 @@ func orgsCreate(t *testing.T, ctx context.Context, db *organizations) {
 	assert.Equal(t, 1, got.NumMembers)
 	assert.Equal(t, db.NowFunc().Format(time.RFC3339), got.Created.UTC().Format(time.RFC3339))
 	assert.Equal(t, db.NowFunc().Format(time.RFC3339), got.Updated.UTC().Format(time.RFC3339))
+
+	t.Run("invite by email", func(t *testing.T) {
+		teamsStore := NewTeamsStore(db.DB)
+		owners, err := teamsStore.GetByName(ctx, org.ID, "Owners")
+		require.NoError(t, err)
+
+		invitesStore := NewTeamInvitesStore(db.DB)
+		token, err := invitesStore.Create(ctx, owners.ID, alice.ID, "newuser@example.com", 72*time.Hour)
+		require.NoError(t, err)
+
+		newUser, err := NewUsersStore(db.DB).Create(ctx, "newuser", "newuser@example.com", CreateUserOptions{})
+		require.NoError(t, err)
+
+		err = invitesStore.Redeem(ctx, token, newUser.ID)
+		require.NoError(t, err)
+
+		isMember, err := teamsStore.HasMember(ctx, owners.ID, newUser.ID)
+		require.NoError(t, err)
+		assert.True(t, isMember, "newuser should have been added to the Owners team")
+
+		_, err = invitesStore.GetByToken(ctx, token)
+		assert.True(t, IsErrTeamInviteNotExist(err), "invite should have been deleted after redemption")
+	})
 }
 
 func orgsGetByName(t *testing.T, ctx context.Context, db *organizations) {
@@ -329,3 +357,214 @@ func orgsCount(t *testing.T, db *organizations) {
 	got = db.Count(ctx)
 	assert.Equal(t, int64(1), got)
 }
+
+func orgsTeamUnitAccess(t *testing.T, ctx context.Context, db *organizations) {
+	tempPictureAvatarUploadPath := filepath.Join(os.TempDir(), "orgsTeamUnitAccess-tempPictureAvatarUploadPath")
+	conf.SetMockPicture(t, conf.PictureOpts{AvatarUploadPath: tempPictureAvatarUploadPath})
+	tempRepositoryRoot := filepath.Join(os.TempDir(), "orgsTeamUnitAccess-tempRepositoryRoot")
+	conf.SetMockRepository(t, conf.RepositoryOpts{Root: tempRepositoryRoot})
+
+	alice, err := NewUsersStore(db.DB).Create(ctx, "alice", "alice@example.com", CreateUserOptions{})
+	require.NoError(t, err)
+
+	org, err := db.Create(ctx, "acme", alice.ID, CreateOrganizationOptions{})
+	require.NoError(t, err)
+
+	teamsStore := NewTeamsStore(db.DB)
+	team, err := teamsStore.Create(ctx, org.ID, CreateTeamOptions{Name: "readers", Authorize: AccessModeRead})
+	require.NoError(t, err)
+
+	repo := &Repository{OwnerID: org.ID, Name: "repo"}
+	require.NoError(t, db.WithContext(ctx).Create(repo).Error)
+	require.NoError(t, db.WithContext(ctx).Create(&TeamRepo{TeamID: team.ID, RepoID: repo.ID}).Error)
+	require.NoError(t, db.WithContext(ctx).Create(&TeamUser{OrgID: org.ID, TeamID: team.ID, UserID: alice.ID}).Error)
+
+	err = teamsStore.SetUnits(ctx, team.ID, []TeamUnit{
+		{Type: UnitCode, AccessMode: AccessModeRead},
+		{Type: UnitIssues, AccessMode: AccessModeWrite},
+	})
+	require.NoError(t, err)
+
+	canOpenIssue, err := teamsStore.HasAccessToUnit(ctx, team.ID, repo.ID, UnitIssues, AccessModeWrite)
+	require.NoError(t, err)
+	assert.True(t, canOpenIssue, "team should be able to open an issue")
+
+	canPush, err := teamsStore.HasAccessToUnit(ctx, team.ID, repo.ID, UnitCode, AccessModeWrite)
+	require.NoError(t, err)
+	assert.False(t, canPush, "team should not be able to push")
+
+	// SetUnits must recalculate Access so alice's Code unit permission (the
+	// one Access itself gates git operations on) takes effect immediately,
+	// not just HasAccessToUnit's own on-the-fly check.
+	access := new(Access)
+	err = db.WithContext(ctx).Where("user_id = ? AND repo_id = ?", alice.ID, repo.ID).First(access).Error
+	require.NoError(t, err)
+	assert.Equal(t, AccessModeRead, access.Mode)
+}
+
+func orgsSecrets(t *testing.T, ctx context.Context, db *organizations) {
+	conf.Security.SecretKey = "orgsSecrets-test-key"
+
+	secretsStore := NewOrgSecretsStore(db.DB)
+
+	_, err := secretsStore.Create(ctx, 1, "SLACK_TOKEN", "xoxb-secret")
+	require.NoError(t, err)
+
+	t.Run("name already exists", func(t *testing.T) {
+		_, err := secretsStore.Create(ctx, 1, "SLACK_TOKEN", "xoxb-other")
+		assert.True(t, IsErrOrgSecretAlreadyExist(err))
+	})
+
+	t.Run("same name different org is fine", func(t *testing.T) {
+		_, err := secretsStore.Create(ctx, 2, "SLACK_TOKEN", "xoxb-org2")
+		assert.NoError(t, err)
+	})
+
+	t.Run("list never returns plaintext", func(t *testing.T) {
+		secrets, err := secretsStore.List(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, secrets, 1)
+		assert.Equal(t, "SLACK_TOKEN", secrets[0].Name)
+		assert.Empty(t, secrets[0].ValueEncrypted)
+	})
+
+	t.Run("round-trips the plaintext value", func(t *testing.T) {
+		got, err := secretsStore.GetByName(ctx, 1, "SLACK_TOKEN")
+		require.NoError(t, err)
+		assert.Equal(t, "xoxb-secret", got)
+	})
+
+	t.Run("resolves into webhook payload and hook script templates", func(t *testing.T) {
+		rendered, err := RenderWithOrgSecrets(ctx, 1, `token={{ .OrgSecrets.SLACK_TOKEN }}`)
+		require.NoError(t, err)
+		assert.Equal(t, "token=xoxb-secret", rendered)
+	})
+}
+
+func orgsAccessibleReposEnv(t *testing.T, ctx context.Context, db *organizations) {
+	tempPictureAvatarUploadPath := filepath.Join(os.TempDir(), "orgsAccessibleReposEnv-tempPictureAvatarUploadPath")
+	conf.SetMockPicture(t, conf.PictureOpts{AvatarUploadPath: tempPictureAvatarUploadPath})
+	tempRepositoryRoot := filepath.Join(os.TempDir(), "orgsAccessibleReposEnv-tempRepositoryRoot")
+	conf.SetMockRepository(t, conf.RepositoryOpts{Root: tempRepositoryRoot})
+
+	alice, err := NewUsersStore(db.DB).Create(ctx, "alice", "alice@example.com", CreateUserOptions{})
+	require.NoError(t, err)
+
+	org, err := db.Create(ctx, "acme", alice.ID, CreateOrganizationOptions{})
+	require.NoError(t, err)
+
+	teamsStore := NewTeamsStore(db.DB)
+	team1, err := teamsStore.Create(ctx, org.ID, CreateTeamOptions{Name: "team1", Authorize: AccessModeRead})
+	require.NoError(t, err)
+	team2, err := teamsStore.Create(ctx, org.ID, CreateTeamOptions{Name: "team2", Authorize: AccessModeRead})
+	require.NoError(t, err)
+	require.NoError(t, teamsStore.AddMember(ctx, team1.ID, alice.ID))
+	require.NoError(t, teamsStore.AddMember(ctx, team2.ID, alice.ID))
+
+	repo1 := &Repository{OwnerID: org.ID, Name: "repo1", UpdatedUnix: 1}
+	repo2 := &Repository{OwnerID: org.ID, Name: "repo2", UpdatedUnix: 2}
+	require.NoError(t, db.WithContext(ctx).Create(repo1).Error)
+	require.NoError(t, db.WithContext(ctx).Create(repo2).Error)
+	// repo1 is shared by both teams; it should only be returned once.
+	require.NoError(t, db.WithContext(ctx).Create(&TeamRepo{TeamID: team1.ID, RepoID: repo1.ID}).Error)
+	require.NoError(t, db.WithContext(ctx).Create(&TeamRepo{TeamID: team2.ID, RepoID: repo1.ID}).Error)
+	require.NoError(t, db.WithContext(ctx).Create(&TeamRepo{TeamID: team2.ID, RepoID: repo2.ID}).Error)
+
+	env, err := db.AccessibleReposEnv(ctx, org.ID, alice.ID)
+	require.NoError(t, err)
+
+	count, err := env.CountRepos()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	repos, err := env.Repos(1, 10)
+	require.NoError(t, err)
+	require.Len(t, repos, 2)
+	// Ordered by updated_unix DESC.
+	assert.Equal(t, repo2.ID, repos[0].ID)
+	assert.Equal(t, repo1.ID, repos[1].ID)
+
+	t.Run("pagination is stable", func(t *testing.T) {
+		page1, err := env.Repos(1, 1)
+		require.NoError(t, err)
+		require.Len(t, page1, 1)
+		assert.Equal(t, repo2.ID, page1[0].ID)
+
+		page2, err := env.Repos(2, 1)
+		require.NoError(t, err)
+		require.Len(t, page2, 1)
+		assert.Equal(t, repo1.ID, page2[0].ID)
+	})
+}
+
+func orgsRename(t *testing.T, ctx context.Context, db *organizations) {
+	tempPictureAvatarUploadPath := filepath.Join(os.TempDir(), "orgsRename-tempPictureAvatarUploadPath")
+	conf.SetMockPicture(t, conf.PictureOpts{AvatarUploadPath: tempPictureAvatarUploadPath})
+	tempRepositoryRoot := filepath.Join(os.TempDir(), "orgsRename-tempRepositoryRoot")
+	conf.SetMockRepository(t, conf.RepositoryOpts{Root: tempRepositoryRoot})
+	require.NoError(t, os.MkdirAll(tempRepositoryRoot, os.ModePerm))
+
+	alice, err := NewUsersStore(db.DB).Create(ctx, "alice", "alice@example.com", CreateUserOptions{})
+	require.NoError(t, err)
+	bob, err := NewUsersStore(db.DB).Create(ctx, "bob", "bob@example.com", CreateUserOptions{})
+	require.NoError(t, err)
+
+	org, err := db.Create(ctx, "acme", alice.ID, CreateOrganizationOptions{})
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(repositoryOwnerDir(org.Name), os.ModePerm))
+
+	t.Run("reserved name", func(t *testing.T) {
+		err := db.Rename(ctx, org.ID, "-")
+		wantErr := ErrNameNotAllowed{
+			args: errutil.Args{
+				"reason": "reserved",
+				"name":   "-",
+			},
+		}
+		assert.Equal(t, wantErr, err)
+	})
+
+	t.Run("name already exists", func(t *testing.T) {
+		err := db.Rename(ctx, org.ID, bob.Name)
+		wantErr := ErrOrganizationAlreadyExist{args: errutil.Args{"name": bob.Name}}
+		assert.Equal(t, wantErr, err)
+	})
+
+	t.Run("successful rename", func(t *testing.T) {
+		err := db.Rename(ctx, org.ID, "acme-corp")
+		require.NoError(t, err)
+
+		got, err := db.GetByName(ctx, "acme-corp")
+		require.NoError(t, err)
+		assert.Equal(t, org.ID, got.ID)
+
+		// Old name resolves via the redirect.
+		got, err = db.GetByName(ctx, "acme")
+		require.NoError(t, err)
+		assert.Equal(t, org.ID, got.ID)
+	})
+}
+
+func orgsTransferOwnership(t *testing.T, ctx context.Context, db *organizations) {
+	tempPictureAvatarUploadPath := filepath.Join(os.TempDir(), "orgsTransferOwnership-tempPictureAvatarUploadPath")
+	conf.SetMockPicture(t, conf.PictureOpts{AvatarUploadPath: tempPictureAvatarUploadPath})
+
+	alice, err := NewUsersStore(db.DB).Create(ctx, "alice", "alice@example.com", CreateUserOptions{})
+	require.NoError(t, err)
+	bob, err := NewUsersStore(db.DB).Create(ctx, "bob", "bob@example.com", CreateUserOptions{})
+	require.NoError(t, err)
+
+	org, err := db.Create(ctx, "acme", alice.ID, CreateOrganizationOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, db.AddMember(ctx, org.ID, bob.ID))
+	require.NoError(t, db.TransferOwnership(ctx, org.ID, bob.ID))
+
+	var aliceMembership OrgUser
+	require.NoError(t, db.WithContext(ctx).Where("org_id = ? AND uid = ?", org.ID, alice.ID).First(&aliceMembership).Error)
+	assert.False(t, aliceMembership.IsOwner)
+
+	var bobMembership OrgUser
+	require.NoError(t, db.WithContext(ctx).Where("org_id = ? AND uid = ?", org.ID, bob.ID).First(&bobMembership).Error)
+	assert.True(t, bobMembership.IsOwner)
+}
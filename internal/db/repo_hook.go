@@ -0,0 +1,30 @@
+// Copyright 2023 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// RenderRepoHookScript renders a git clone/push hook script template
+// (pre-receive, post-receive, etc.) for repo, resolving
+// `{{ .OrgSecrets.NAME }}` references to the owning organization's
+// decrypted secrets. It's a no-op for repositories owned by a regular user.
+func RenderRepoHookScript(ctx context.Context, repo *Repository, tmplText string) (string, error) {
+	owner := new(Organization)
+	err := Organizations.WithContext(ctx).
+		Where("id = ? AND type = ?", repo.OwnerID, UserTypeOrganization).
+		First(owner).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tmplText, nil
+		}
+		return "", errors.Wrap(err, "check repo owner")
+	}
+	return RenderWithOrgSecrets(ctx, owner.ID, tmplText)
+}
@@ -0,0 +1,227 @@
+// Copyright 2023 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+
+	"gogs.io/gogs/internal/errutil"
+)
+
+// maxPendingTeamInvitesPerOrg caps the number of outstanding invitations an
+// organization can have at once, to keep a compromised or careless owner
+// from mail-bombing arbitrary addresses.
+const maxPendingTeamInvitesPerOrg = 50
+
+// TeamInvite is a pending invitation for someone to join a team by email,
+// sent before the invitee necessarily has an account.
+type TeamInvite struct {
+	ID        int64
+	TeamID    int64
+	InviterID int64
+	Email     string `gorm:"index"`
+
+	// TokenHash is the SHA-256 hash of the token that was emailed to Email.
+	// The plaintext token is never persisted.
+	TokenHash string `gorm:"uniqueIndex"`
+
+	CreatedUnix int64
+	ExpiresUnix int64
+}
+
+func (*TeamInvite) TableName() string {
+	return "team_invite"
+}
+
+func (invite *TeamInvite) BeforeCreate(tx *gorm.DB) error {
+	if invite.CreatedUnix == 0 {
+		invite.CreatedUnix = tx.NowFunc().Unix()
+	}
+	return nil
+}
+
+// TeamInvites is the interface for team invitation operations.
+type TeamInvites interface {
+	// Create creates a new pending invitation for email to join teamID, and
+	// returns the plaintext token to be emailed to the invitee. It returns
+	// ErrTooManyPendingInvites when the team's organization already has
+	// maxPendingTeamInvitesPerOrg pending invitations.
+	Create(ctx context.Context, teamID, inviterID int64, email string, expiresIn time.Duration) (token string, err error)
+	// GetByToken returns the invitation matching the given plaintext token.
+	// It returns ErrTeamInviteNotExist if no invitation matches, including
+	// when it has expired.
+	GetByToken(ctx context.Context, token string) (*TeamInvite, error)
+	// ListByTeam returns all pending invitations for the given team.
+	ListByTeam(ctx context.Context, teamID int64) ([]*TeamInvite, error)
+	// Redeem atomically adds userID to the team the token was issued for and
+	// deletes the invitation. It returns ErrTeamInviteNotExist if the token
+	// is invalid, unknown or expired.
+	Redeem(ctx context.Context, token string, userID int64) error
+	// Delete removes the given invitation.
+	Delete(ctx context.Context, id int64) error
+	// DeleteExpired removes all invitations whose expiry has passed, and
+	// returns how many were deleted. It is intended to be called
+	// periodically from a cron job.
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+var TeamInvitesStore TeamInvites
+
+// NewTeamInvitesStore returns a persistent TeamInvites store backed by db.
+func NewTeamInvitesStore(db *gorm.DB) TeamInvites {
+	return &teamInvites{DB: db}
+}
+
+type teamInvites struct {
+	*gorm.DB
+}
+
+func hashInviteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newInviteToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "read random bytes")
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (db *teamInvites) Create(ctx context.Context, teamID, inviterID int64, email string, expiresIn time.Duration) (string, error) {
+	team := new(Team)
+	err := db.WithContext(ctx).Where("id = ?", teamID).First(team).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrTeamNotExist{}
+		}
+		return "", errors.Wrap(err, "get team")
+	}
+
+	var pending int64
+	err = db.WithContext(ctx).
+		Model(&TeamInvite{}).
+		Joins("INNER JOIN team ON team.id = team_invite.team_id").
+		Where("team.org_id = ? AND team_invite.expires_unix > ?", team.OrgID, db.NowFunc().Unix()).
+		Count(&pending).Error
+	if err != nil {
+		return "", errors.Wrap(err, "count pending invites")
+	}
+	if pending >= maxPendingTeamInvitesPerOrg {
+		return "", ErrTooManyPendingInvites{args: errutil.Args{"orgID": team.OrgID}}
+	}
+
+	token, err := newInviteToken()
+	if err != nil {
+		return "", errors.Wrap(err, "generate token")
+	}
+
+	now := db.NowFunc()
+	invite := &TeamInvite{
+		TeamID:      teamID,
+		InviterID:   inviterID,
+		Email:       email,
+		TokenHash:   hashInviteToken(token),
+		ExpiresUnix: now.Add(expiresIn).Unix(),
+	}
+	if err := db.WithContext(ctx).Create(invite).Error; err != nil {
+		return "", errors.Wrap(err, "create invite")
+	}
+	return token, nil
+}
+
+func (db *teamInvites) GetByToken(ctx context.Context, token string) (*TeamInvite, error) {
+	invite := new(TeamInvite)
+	err := db.WithContext(ctx).
+		Where("token_hash = ? AND expires_unix > ?", hashInviteToken(token), db.NowFunc().Unix()).
+		First(invite).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTeamInviteNotExist{}
+		}
+		return nil, errors.Wrap(err, "get invite")
+	}
+	return invite, nil
+}
+
+func (db *teamInvites) ListByTeam(ctx context.Context, teamID int64) ([]*TeamInvite, error) {
+	var invites []*TeamInvite
+	err := db.WithContext(ctx).Where("team_id = ?", teamID).Find(&invites).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "list invites")
+	}
+	return invites, nil
+}
+
+func (db *teamInvites) Redeem(ctx context.Context, token string, userID int64) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		invite := new(TeamInvite)
+		err := tx.Where("token_hash = ? AND expires_unix > ?", hashInviteToken(token), tx.NowFunc().Unix()).
+			First(invite).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTeamInviteNotExist{}
+			}
+			return errors.Wrap(err, "get invite")
+		}
+
+		err = NewTeamsStore(tx).AddMember(ctx, invite.TeamID, userID)
+		if err != nil {
+			return errors.Wrap(err, "add team member")
+		}
+
+		return tx.Delete(invite).Error
+	})
+}
+
+func (db *teamInvites) Delete(ctx context.Context, id int64) error {
+	return db.WithContext(ctx).Where("id = ?", id).Delete(&TeamInvite{}).Error
+}
+
+func (db *teamInvites) DeleteExpired(ctx context.Context) (int64, error) {
+	tx := db.WithContext(ctx).Where("expires_unix <= ?", db.NowFunc().Unix()).Delete(&TeamInvite{})
+	return tx.RowsAffected, tx.Error
+}
+
+// ErrTeamInviteNotExist is returned when a team invitation does not exist or
+// has expired.
+type ErrTeamInviteNotExist struct{}
+
+// IsErrTeamInviteNotExist returns true if the underlying error has the type
+// ErrTeamInviteNotExist.
+func IsErrTeamInviteNotExist(err error) bool {
+	_, ok := errors.Cause(err).(ErrTeamInviteNotExist)
+	return ok
+}
+
+func (ErrTeamInviteNotExist) Error() string {
+	return "team invite does not exist or has expired"
+}
+
+// ErrTooManyPendingInvites is returned when an organization already has the
+// maximum number of pending team invitations.
+type ErrTooManyPendingInvites struct {
+	args errutil.Args
+}
+
+// IsErrTooManyPendingInvites returns true if the underlying error has the
+// type ErrTooManyPendingInvites.
+func IsErrTooManyPendingInvites(err error) bool {
+	_, ok := errors.Cause(err).(ErrTooManyPendingInvites)
+	return ok
+}
+
+func (err ErrTooManyPendingInvites) Error() string {
+	return fmt.Sprintf("organization has too many pending invites: %v", err.args)
+}
@@ -0,0 +1,210 @@
+// Copyright 2023 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// UnitType is the type of a repository unit, i.e. a feature area that can be
+// independently gated by team permissions.
+type UnitType int
+
+const (
+	UnitCode UnitType = iota + 1
+	UnitIssues
+	UnitPullRequests
+	UnitReleases
+	UnitWiki
+	UnitExternalWiki
+	UnitExternalTracker
+	UnitProjects
+	UnitPackages
+)
+
+// TeamUnit describes the access mode a team has been granted for a single
+// unit. Unlike Team.Authorize, which applies uniformly to every unit of
+// every repository the team has access to, TeamUnit allows different units
+// to be gated at different access modes, e.g. a team may have write access
+// to issues but only read access to code.
+type TeamUnit struct {
+	ID         int64
+	TeamID     int64    `gorm:"uniqueIndex:team_unit_team_type_unique"`
+	Type       UnitType `gorm:"uniqueIndex:team_unit_team_type_unique"`
+	AccessMode AccessMode
+}
+
+func (*TeamUnit) TableName() string {
+	return "team_unit"
+}
+
+// GetUnits returns the units explicitly configured for the given team. The
+// returned slice is empty if the team has not had per-unit permissions
+// configured, in which case callers should fall back to the team's uniform
+// Authorize mode.
+func (db *teams) GetUnits(ctx context.Context, teamID int64) ([]*TeamUnit, error) {
+	var units []*TeamUnit
+	err := db.WithContext(ctx).Where("team_id = ?", teamID).Find(&units).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "get team units")
+	}
+	return units, nil
+}
+
+// SetUnits overwrites the set of units configured for the given team with
+// units, then recalculates Access so the team's Code unit permission (the
+// one Access itself gates git operations on) takes effect immediately.
+func (db *teams) SetUnits(ctx context.Context, teamID int64, units []TeamUnit) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("team_id = ?", teamID).Delete(&TeamUnit{}).Error
+		if err != nil {
+			return errors.Wrap(err, "delete existing team units")
+		}
+
+		for i := range units {
+			units[i].TeamID = teamID
+			if err := tx.Create(&units[i]).Error; err != nil {
+				return errors.Wrap(err, "create team unit")
+			}
+		}
+
+		team := new(Team)
+		if err := tx.Where("id = ?", teamID).First(team).Error; err != nil {
+			return errors.Wrap(err, "get team")
+		}
+		return recalculateTeamAccesses(ctx, tx, team.OrgID)
+	})
+}
+
+// HasAccessToUnit reports whether the given team has at least minMode access
+// to the given unit on the given repository. A team that has no per-unit
+// permissions configured for the repository's unit falls back to its
+// uniform Authorize mode, preserving behavior for teams created before
+// per-unit permissions existed.
+func (db *teams) HasAccessToUnit(ctx context.Context, teamID, repoID int64, unit UnitType, minMode AccessMode) (bool, error) {
+	team := new(Team)
+	err := db.WithContext(ctx).Where("id = ?", teamID).First(team).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, ErrTeamNotExist{}
+		}
+		return false, errors.Wrap(err, "get team")
+	}
+
+	var count int64
+	err = db.WithContext(ctx).Model(&TeamRepo{}).Where("team_id = ? AND repo_id = ?", teamID, repoID).Count(&count).Error
+	if err != nil {
+		return false, errors.Wrap(err, "check team repository")
+	} else if count == 0 {
+		return false, nil
+	}
+
+	teamUnit := new(TeamUnit)
+	err = db.WithContext(ctx).Where("team_id = ? AND type = ?", teamID, unit).First(teamUnit).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return team.Authorize >= minMode, nil
+		}
+		return false, errors.Wrap(err, "get team unit")
+	}
+	return teamUnit.AccessMode >= minMode, nil
+}
+
+// Access is the effective access mode a user has to a repository, computed
+// from every team the user belongs to that has access to it. It mirrors the
+// mode a user's team grants on the Code unit specifically, since Access has
+// always been the table git operations (pull/push) gate on; permissions on
+// other units are looked up directly via Teams.HasAccessToUnit instead of
+// being duplicated here.
+type Access struct {
+	ID     int64
+	UserID int64 `gorm:"uniqueIndex:access_user_repo_unique"`
+	RepoID int64 `gorm:"uniqueIndex:access_user_repo_unique"`
+	Mode   AccessMode
+}
+
+func (*Access) TableName() string {
+	return "access"
+}
+
+// recalculateTeamAccesses recomputes the (user_id, repo_id)-keyed Access
+// rows for every member of every team in orgID, reflecting each team's
+// current Code unit permission rather than its uniform Authorize mode.
+// Access has always been the table git operations (pull/push) gate on, so
+// unit-awareness here means: a team's Code TeamUnit (falling back to its
+// Authorize mode when unset, per HasAccessToUnit's own semantics) decides
+// the Access.Mode a member ends up with for a repo. Permissions on other
+// units (Issues, Wiki, ...) aren't stored in Access at all; route handlers
+// for those call Teams.HasAccessToUnit directly. A user who belongs to more
+// than one team with access to the same repo gets the highest Code mode
+// across those teams.
+func recalculateTeamAccesses(ctx context.Context, tx *gorm.DB, orgID int64) error {
+	err := tx.WithContext(ctx).
+		Where("user_id IN (SELECT uid FROM team_user INNER JOIN team ON team.id = team_user.team_id WHERE team.org_id = ?)", orgID).
+		Where("repo_id IN (SELECT id FROM repository WHERE owner_id = ?)", orgID).
+		Delete(&Access{}).Error
+	if err != nil {
+		return errors.Wrap(err, "clear existing accesses")
+	}
+
+	var teamRepos []*TeamRepo
+	err = tx.WithContext(ctx).
+		Joins("INNER JOIN team ON team.id = team_repo.team_id").
+		Where("team.org_id = ?", orgID).
+		Find(&teamRepos).Error
+	if err != nil {
+		return errors.Wrap(err, "list org team repos")
+	}
+
+	for _, tr := range teamRepos {
+		team := new(Team)
+		if err := tx.WithContext(ctx).Where("id = ?", tr.TeamID).First(team).Error; err != nil {
+			return errors.Wrapf(err, "get team %d", tr.TeamID)
+		}
+
+		mode := team.Authorize
+		teamUnit := new(TeamUnit)
+		err = tx.WithContext(ctx).Where("team_id = ? AND type = ?", tr.TeamID, UnitCode).First(teamUnit).Error
+		switch {
+		case err == nil:
+			mode = teamUnit.AccessMode
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// Fall back to the team's uniform Authorize mode.
+		default:
+			return errors.Wrap(err, "get team code unit")
+		}
+
+		var memberIDs []int64
+		err = tx.WithContext(ctx).Model(&TeamUser{}).Where("team_id = ?", tr.TeamID).
+			Pluck("uid", &memberIDs).Error
+		if err != nil {
+			return errors.Wrapf(err, "list team %d members", tr.TeamID)
+		}
+
+		for _, userID := range memberIDs {
+			access := new(Access)
+			err = tx.WithContext(ctx).Where("user_id = ? AND repo_id = ?", userID, tr.RepoID).First(access).Error
+			switch {
+			case err == nil:
+				if mode > access.Mode {
+					if err := tx.Model(access).Update("mode", mode).Error; err != nil {
+						return errors.Wrap(err, "raise existing access")
+					}
+				}
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				err = tx.Create(&Access{UserID: userID, RepoID: tr.RepoID, Mode: mode}).Error
+				if err != nil {
+					return errors.Wrap(err, "create access")
+				}
+			default:
+				return errors.Wrap(err, "get existing access")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+)
+
+// HookEventType is the type of repository event a webhook fires on.
+type HookEventType string
+
+const (
+	HookEventTypePush        HookEventType = "push"
+	HookEventTypeCreate      HookEventType = "create"
+	HookEventTypeDelete      HookEventType = "delete"
+	HookEventTypeIssues      HookEventType = "issues"
+	HookEventTypePullRequest HookEventType = "pull_request"
+	HookEventTypeRelease     HookEventType = "release"
+)
+
+// HookStatus is the outcome of the most recent delivery attempt for a
+// webhook.
+type HookStatus int
+
+const (
+	HookStatusNone HookStatus = iota
+	HookStatusSucceed
+	HookStatusFailed
+)
+
+// Webhook represents an outgoing webhook configured on a repository or,
+// when OrgID is set, centrally on an organization.
+type Webhook struct {
+	ID     int64
+	RepoID int64
+	OrgID  int64
+	URL    string
+	// Secret, when non-empty, is used to sign each delivery's payload with
+	// HMAC-SHA256 so the receiving endpoint can verify it actually came from
+	// this instance.
+	Secret      string
+	ContentType string
+	Events      string // Comma-separated list of HookEventType this webhook fires on.
+	IsActive    bool
+
+	LastStatus  HookStatus
+	CreatedUnix int64
+	UpdatedUnix int64
+}
+
+func (*Webhook) TableName() string {
+	return "webhook"
+}
+
+// RenderedPayload renders payload through RenderWithOrgSecrets so that
+// `{{ .OrgSecrets.NAME }}` resolves to the owning organization's decrypted
+// secret before it's POSTed to w.URL. It's a no-op for webhooks that don't
+// belong to an organization.
+func (w *Webhook) RenderedPayload(ctx context.Context, payload string) (string, error) {
+	if w.OrgID == 0 {
+		return payload, nil
+	}
+	return RenderWithOrgSecrets(ctx, w.OrgID, payload)
+}
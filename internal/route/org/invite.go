@@ -0,0 +1,62 @@
+// Copyright 2023 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package org
+
+import (
+	log "unknwon.dev/clog/v2"
+
+	"gogs.io/gogs/internal/context"
+	"gogs.io/gogs/internal/db"
+)
+
+const (
+	TEAM_INVITE = "org/team/invite"
+)
+
+// RedeemInvite handles GET /org/{org}/teams/{team}/invitations/{token}.
+//
+// If the visitor is not signed in, they're shown a sign-up/login prompt that
+// remembers the invite token across the redirect. If they are signed in and
+// their verified email matches the invite, they're added to the team and
+// the invite is consumed. Any other signed-in user sees an error, since the
+// invite is only valid for the email address it was sent to.
+func RedeemInvite(c *context.Context) {
+	token := c.Params(":token")
+
+	invite, err := db.TeamInvitesStore.GetByToken(c.Req.Context(), token)
+	if err != nil {
+		if db.IsErrTeamInviteNotExist(err) {
+			c.NotFound()
+			return
+		}
+		c.Error(err, "get team invite")
+		return
+	}
+
+	if c.User.ID == 0 {
+		c.Session.Set("redirect_to", c.Req.URL.RequestURI())
+		c.RedirectSubpath("/user/login")
+		return
+	}
+
+	if !c.User.IsActive || c.User.Email != invite.Email {
+		c.Flash.Error(c.Tr("org.teams.invite_wrong_email"))
+		c.RedirectSubpath("/")
+		return
+	}
+
+	err = db.TeamInvitesStore.Redeem(c.Req.Context(), token, c.User.ID)
+	if err != nil {
+		if db.IsErrTeamInviteNotExist(err) {
+			c.NotFound()
+			return
+		}
+		c.Error(err, "redeem team invite")
+		return
+	}
+	log.Trace("Team invite redeemed: team %d, user %d", invite.TeamID, c.User.ID)
+
+	c.RedirectSubpath("/org/" + c.Params(":org") + "/teams/" + c.Params(":team"))
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package org
+
+import (
+	log "unknwon.dev/clog/v2"
+
+	"gogs.io/gogs/internal/context"
+	"gogs.io/gogs/internal/db"
+	"gogs.io/gogs/internal/form"
+)
+
+const (
+	SETTINGS_SECRETS = "org/settings/secrets"
+)
+
+// Secrets handles GET /org/{org}/settings/secrets. Only members with admin
+// rights on the organization may reach this route; the list never includes
+// decrypted values.
+func Secrets(c *context.Context) {
+	if !c.Org.IsOwner {
+		c.NotFound()
+		return
+	}
+
+	c.Title("org.settings")
+	c.PageIs("SettingsSecrets")
+
+	secrets, err := db.OrgSecretsStore.List(c.Req.Context(), c.Org.Organization.ID)
+	if err != nil {
+		c.Error(err, "list organization secrets")
+		return
+	}
+	c.Data["Secrets"] = secrets
+
+	c.Success(SETTINGS_SECRETS)
+}
+
+// SecretsPost handles POST /org/{org}/settings/secrets.
+func SecretsPost(c *context.Context, f form.OrgSecret) {
+	if !c.Org.IsOwner {
+		c.NotFound()
+		return
+	}
+
+	_, err := db.OrgSecretsStore.Create(c.Req.Context(), c.Org.Organization.ID, f.Name, f.Value)
+	if err != nil {
+		if db.IsErrOrgSecretAlreadyExist(err) {
+			c.Flash.Error(c.Tr("org.settings.secrets.name_been_taken"))
+		} else {
+			c.Error(err, "create organization secret")
+			return
+		}
+	} else {
+		log.Trace("Organization secret created: %s/%s", c.Org.Organization.Name, f.Name)
+		c.Flash.Success(c.Tr("org.settings.secrets.created"))
+	}
+
+	c.RedirectSubpath("/org/" + c.Org.Organization.Name + "/settings/secrets")
+}
+
+// SecretsDelete handles POST /org/{org}/settings/secrets/{name}/delete.
+func SecretsDelete(c *context.Context) {
+	if !c.Org.IsOwner {
+		c.NotFound()
+		return
+	}
+
+	name := c.Params(":name")
+	err := db.OrgSecretsStore.Delete(c.Req.Context(), c.Org.Organization.ID, name)
+	if err != nil {
+		c.Error(err, "delete organization secret")
+		return
+	}
+	log.Trace("Organization secret deleted: %s/%s", c.Org.Organization.Name, name)
+
+	c.Flash.Success(c.Tr("org.settings.secrets.deleted"))
+	c.RedirectSubpath("/org/" + c.Org.Organization.Name + "/settings/secrets")
+}